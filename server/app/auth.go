@@ -35,22 +35,45 @@ func Login(ds model.DataStore) func(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		handleLogin(ds, username, password, w, r)
+		key := loginThrottleKey(username, clientIP(r))
+		if wait, locked := checkLoginThrottle(key); locked || wait > 0 {
+			retryAfterHeader(w, wait)
+			log.Warn(r, "Login throttled", "username", username, "locked", locked)
+			rest.RespondWithError(w, http.StatusTooManyRequests, "Too many failed login attempts. Please try again later.")
+			return
+		}
+
+		if handleLogin(ds, username, password, w, r) {
+			clearLoginThrottle(key)
+		} else {
+			recordFailedLogin(key)
+		}
 	}
 }
 
-func handleLogin(ds model.DataStore, username string, password string, w http.ResponseWriter, r *http.Request) {
+func handleLogin(ds model.DataStore, username string, password string, w http.ResponseWriter, r *http.Request) bool {
 	user, err := validateLogin(ds.User(r.Context()), username, password)
 	if err != nil {
 		rest.RespondWithError(w, http.StatusInternalServerError, "Unknown error authentication user. Please try again")
-		return
+		return false
 	}
 	if user == nil {
 		log.Warn(r, "Unsuccessful login", "username", username, "request", r.Header)
 		rest.RespondWithError(w, http.StatusUnauthorized, "Invalid username or password")
-		return
+		return false
 	}
 
+	sendLoginResponse(user, w, r)
+	return true
+}
+
+// handleLoginForUser mints a JWT for a user that has already been authenticated by
+// some other means (e.g. an OAuth2 provider), skipping the password check.
+func handleLoginForUser(user *model.User, w http.ResponseWriter, r *http.Request) {
+	sendLoginResponse(user, w, r)
+}
+
+func sendLoginResponse(user *model.User, w http.ResponseWriter, r *http.Request) {
 	tokenString, err := auth.CreateToken(user)
 	if err != nil {
 		rest.RespondWithError(w, http.StatusInternalServerError, "Unknown error authenticating user. Please try again")
@@ -58,10 +81,10 @@ func handleLogin(ds model.DataStore, username string, password string, w http.Re
 	}
 	rest.RespondWithJSON(w, http.StatusOK,
 		map[string]interface{}{
-			"message":  "User '" + username + "' authenticated successfully",
+			"message":  "User '" + user.UserName + "' authenticated successfully",
 			"token":    tokenString,
 			"name":     user.Name,
-			"username": username,
+			"username": user.UserName,
 			"isAdmin":  user.IsAdmin,
 			"version":  consts.Version(),
 		})
@@ -109,19 +132,26 @@ func CreateAdmin(ds model.DataStore) func(w http.ResponseWriter, r *http.Request
 }
 
 func createDefaultUser(ctx context.Context, ds model.DataStore, username, password string) error {
+	if err := validatePasswordPolicy(password); err != nil {
+		return err
+	}
 	id, _ := uuid.NewRandom()
 	log.Warn("Creating initial user", "user", username)
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
 	now := time.Now()
 	initialUser := model.User{
 		ID:          id.String(),
 		UserName:    username,
 		Name:        strings.Title(username),
 		Email:       "",
-		Password:    password,
+		Password:    hash,
 		IsAdmin:     true,
 		LastLoginAt: &now,
 	}
-	err := ds.User(ctx).Put(&initialUser)
+	err = ds.User(ctx).Put(&initialUser)
 	if err != nil {
 		log.Error("Could not create initial user", "user", initialUser, err)
 	}
@@ -136,9 +166,21 @@ func validateLogin(userRepo model.UserRepository, userName, password string) (*m
 	if err != nil {
 		return nil, err
 	}
-	if u.Password != password {
+	if !passwordMatches(u.Password, password) {
 		return nil, nil
 	}
+	// Transparently upgrade legacy plaintext passwords to bcrypt now that we know
+	// the plaintext value matches.
+	if !isHashedPassword(u.Password) {
+		if hash, err := hashPassword(password); err == nil {
+			u.Password = hash
+			if err := userRepo.Put(u); err != nil {
+				log.Error("Could not rehash password", "user", userName, err)
+			}
+		} else {
+			log.Error("Could not rehash password", "user", userName, err)
+		}
+	}
 	err = userRepo.UpdateLastLoginAt(u.ID)
 	if err != nil {
 		log.Error("Could not update LastLoginAt", "user", userName)
@@ -169,11 +211,60 @@ func getToken(ds model.DataStore, ctx context.Context) (*jwt.Token, error) {
 	return nil, errors.New("invalid authentication")
 }
 
+// bearerAccessToken extracts the raw value of a `Bearer nvd_<token>` Authorization
+// header, returning "" if the header isn't in that form.
+func bearerAccessToken(r *http.Request) string {
+	value := r.Header.Get("Authorization")
+	if !strings.HasPrefix(value, "Bearer ") {
+		return ""
+	}
+	value = strings.TrimPrefix(value, "Bearer ")
+	if !strings.HasPrefix(value, accessTokenPrefix) {
+		return ""
+	}
+	return value
+}
+
 func Authenticator(ds model.DataStore) func(next http.Handler) http.Handler {
 	auth.InitTokenAuth(ds)
 
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if user, attempted, err := reverseProxyUser(r.Context(), ds, r); attempted {
+				if err != nil {
+					log.Warn(r, "Rejecting reverse-proxy auth header", err)
+					rest.RespondWithError(w, http.StatusUnauthorized, "Not authenticated")
+					return
+				}
+				tokenString, err := auth.CreateToken(user)
+				if err != nil {
+					log.Error(r, "signing new token", err)
+					rest.RespondWithError(w, http.StatusUnauthorized, "Not authenticated")
+					return
+				}
+				w.Header().Set("Authorization", tokenString)
+				newCtx := context.WithValue(r.Context(), "user", user)
+				next.ServeHTTP(w, r.WithContext(newCtx))
+				return
+			}
+
+			if tokenValue := bearerAccessToken(r); tokenValue != "" {
+				user, scopes, err := authenticateAccessToken(r.Context(), ds, tokenValue)
+				if err != nil {
+					log.Error(r, "Authenticating access token", err)
+					rest.RespondWithError(w, http.StatusUnauthorized, "Not authenticated")
+					return
+				}
+				if user == nil {
+					rest.RespondWithError(w, http.StatusUnauthorized, "Not authenticated")
+					return
+				}
+				newCtx := context.WithValue(r.Context(), "user", user)
+				newCtx = context.WithValue(newCtx, tokenScopesContextKey{}, scopes)
+				next.ServeHTTP(w, r.WithContext(newCtx))
+				return
+			}
+
 			token, err := getToken(ds, r.Context())
 			if err == ErrFirstTime {
 				rest.RespondWithJSON(w, http.StatusUnauthorized, map[string]string{"message": ErrFirstTime.Error()})
@@ -0,0 +1,118 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"unicode"
+
+	"github.com/deluan/navidrome/log"
+	"github.com/deluan/navidrome/model"
+	"github.com/deluan/rest"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// minPasswordLength is the minimum length enforced by validatePasswordPolicy,
+// which additionally requires at least one letter and one digit.
+const minPasswordLength = 8
+
+var errWeakPassword = errors.New("password must be at least 8 characters long and contain letters and numbers")
+
+// hashPassword hashes a plaintext password for storage.
+func hashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// isHashedPassword tells apart the bcrypt hashes we write today from the plaintext
+// values that may still be sitting in a database created by an older version of
+// Navidrome.
+func isHashedPassword(password string) bool {
+	return strings.HasPrefix(password, "$2a$") ||
+		strings.HasPrefix(password, "$2b$") ||
+		strings.HasPrefix(password, "$2y$")
+}
+
+// validatePasswordPolicy enforces a minimal password strength policy on user
+// creation and password changes.
+func validatePasswordPolicy(password string) error {
+	if len(password) < minPasswordLength {
+		return errWeakPassword
+	}
+	var hasLetter, hasDigit bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLetter(r):
+			hasLetter = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		}
+	}
+	if !hasLetter || !hasDigit {
+		return errWeakPassword
+	}
+	return nil
+}
+
+// ChangePassword lets an authenticated user change their own password, after
+// verifying the current one.
+func ChangePassword(ds model.DataStore) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := r.Context().Value("user").(*model.User)
+		if !ok || user == nil {
+			rest.RespondWithError(w, http.StatusUnauthorized, "Not authenticated")
+			return
+		}
+		if !requireScope(r.Context(), ScopeWrite) {
+			rest.RespondWithError(w, http.StatusForbidden, "Access token scope does not permit changing the password")
+			return
+		}
+
+		var body struct {
+			OldPassword string `json:"oldPassword"`
+			NewPassword string `json:"newPassword"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			log.Error(r, "Parsing request body", err)
+			rest.RespondWithError(w, http.StatusUnprocessableEntity, "Invalid request payload")
+			return
+		}
+
+		if !passwordMatches(user.Password, body.OldPassword) {
+			rest.RespondWithError(w, http.StatusUnauthorized, "Current password is incorrect")
+			return
+		}
+		if err := validatePasswordPolicy(body.NewPassword); err != nil {
+			rest.RespondWithError(w, http.StatusUnprocessableEntity, err.Error())
+			return
+		}
+
+		hash, err := hashPassword(body.NewPassword)
+		if err != nil {
+			log.Error(r, "Hashing new password", err)
+			rest.RespondWithError(w, http.StatusInternalServerError, "Could not change password")
+			return
+		}
+		user.Password = hash
+		if err := ds.User(r.Context()).Put(user); err != nil {
+			log.Error(r, "Saving new password", err)
+			rest.RespondWithError(w, http.StatusInternalServerError, "Could not change password")
+			return
+		}
+
+		rest.RespondWithJSON(w, http.StatusOK, map[string]string{"message": "Password changed successfully"})
+	}
+}
+
+// passwordMatches compares a plaintext candidate against a stored password,
+// transparently supporting both bcrypt hashes and legacy plaintext values.
+func passwordMatches(stored, candidate string) bool {
+	if isHashedPassword(stored) {
+		return bcrypt.CompareHashAndPassword([]byte(stored), []byte(candidate)) == nil
+	}
+	return stored == candidate
+}
@@ -0,0 +1,118 @@
+package app
+
+import (
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/deluan/navidrome/model"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+// fakeUserRepo implements just enough of model.UserRepository for these tests,
+// by embedding the interface and overriding the handful of methods exercised
+// by validateLogin. Any other method call panics on the nil embedded value,
+// which is fine since validateLogin never reaches them.
+type fakeUserRepo struct {
+	model.UserRepository
+	users map[string]*model.User
+}
+
+func newFakeUserRepo(users ...*model.User) *fakeUserRepo {
+	repo := &fakeUserRepo{users: map[string]*model.User{}}
+	for _, u := range users {
+		repo.users[u.UserName] = u
+	}
+	return repo
+}
+
+func (f *fakeUserRepo) FindByUsername(username string) (*model.User, error) {
+	if u, ok := f.users[username]; ok {
+		return u, nil
+	}
+	return nil, model.ErrNotFound
+}
+
+func (f *fakeUserRepo) Put(u *model.User) error {
+	f.users[u.UserName] = u
+	return nil
+}
+
+func (f *fakeUserRepo) UpdateLastLoginAt(id string) error {
+	return nil
+}
+
+var _ = Describe("isHashedPassword", func() {
+	DescribeTable("telling bcrypt hashes apart from plaintext",
+		func(password string, want bool) {
+			Expect(isHashedPassword(password)).To(Equal(want))
+		},
+		Entry("2a prefix", "$2a$10$abcdefghijklmnopqrstuv", true),
+		Entry("2b prefix", "$2b$10$abcdefghijklmnopqrstuv", true),
+		Entry("2y prefix", "$2y$10$abcdefghijklmnopqrstuv", true),
+		Entry("legacy plaintext", "hunter2", false),
+		Entry("empty string", "", false),
+	)
+})
+
+var _ = Describe("passwordMatches", func() {
+	It("matches a bcrypt hash against its plaintext", func() {
+		hash, err := hashPassword("correct horse battery staple")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(passwordMatches(hash, "correct horse battery staple")).To(BeTrue())
+	})
+
+	It("rejects the wrong plaintext against a bcrypt hash", func() {
+		hash, err := hashPassword("correct horse battery staple")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(passwordMatches(hash, "wrong password")).To(BeFalse())
+	})
+
+	It("falls back to a direct comparison for legacy plaintext passwords", func() {
+		Expect(passwordMatches("hunter2", "hunter2")).To(BeTrue())
+		Expect(passwordMatches("hunter2", "hunter3")).To(BeFalse())
+	})
+})
+
+var _ = Describe("validateLogin", func() {
+	It("logs in and transparently upgrades a matching legacy plaintext password", func() {
+		user := &model.User{ID: "1", UserName: "alice", Password: "hunter2"}
+		repo := newFakeUserRepo(user)
+
+		got, err := validateLogin(repo, "alice", "hunter2")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(got).ToNot(BeNil())
+
+		stored := repo.users["alice"]
+		Expect(isHashedPassword(stored.Password)).To(BeTrue())
+		Expect(bcrypt.CompareHashAndPassword([]byte(stored.Password), []byte("hunter2"))).To(Succeed())
+	})
+
+	It("does not touch the stored hash when the password is already bcrypt", func() {
+		hash, err := hashPassword("hunter2")
+		Expect(err).ToNot(HaveOccurred())
+		user := &model.User{ID: "1", UserName: "alice", Password: hash}
+		repo := newFakeUserRepo(user)
+
+		_, err = validateLogin(repo, "alice", "hunter2")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(repo.users["alice"].Password).To(Equal(hash))
+	})
+
+	It("returns no user and no error for a wrong password", func() {
+		user := &model.User{ID: "1", UserName: "alice", Password: "hunter2"}
+		repo := newFakeUserRepo(user)
+
+		got, err := validateLogin(repo, "alice", "wrong")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(got).To(BeNil())
+	})
+
+	It("returns no user and no error for an unknown username", func() {
+		repo := newFakeUserRepo()
+
+		got, err := validateLogin(repo, "nobody", "whatever")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(got).To(BeNil())
+	})
+})
@@ -0,0 +1,93 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/deluan/navidrome/conf"
+	"github.com/deluan/navidrome/model"
+	"github.com/google/uuid"
+)
+
+// reverseProxyUser resolves the user asserted by a trusted reverse proxy, for
+// deployments that front Navidrome with something like Authelia, Authentik or
+// oauth2-proxy. attempted reports whether the configured header was present at
+// all, so callers can tell "not using this feature" apart from "rejected".
+func reverseProxyUser(ctx context.Context, ds model.DataStore, r *http.Request) (user *model.User, attempted bool, err error) {
+	if !conf.Server.ReverseProxyAuth {
+		return nil, false, nil
+	}
+	headerName := conf.Server.ReverseProxyUserHeader
+	if headerName == "" {
+		return nil, false, nil
+	}
+	username := r.Header.Get(headerName)
+	if username == "" {
+		return nil, false, nil
+	}
+	attempted = true
+
+	peerIP := directPeerIP(r)
+	if !ipMatchesAny(peerIP, conf.Server.ReverseProxyAllowedIPs) {
+		return nil, attempted, fmt.Errorf("reverse-proxy header %q received from untrusted source %s", headerName, peerIP)
+	}
+
+	userRepo := ds.User(ctx)
+	u, err := userRepo.FindByUsername(username)
+	if err == model.ErrNotFound {
+		u, err = provisionReverseProxyUser(ctx, ds, username)
+	}
+	if err != nil {
+		return nil, attempted, err
+	}
+	return u, attempted, nil
+}
+
+// provisionReverseProxyUser auto-creates a local account for a username asserted
+// by a trusted reverse proxy the first time we see it, mirroring how OAuth logins
+// provision new users.
+func provisionReverseProxyUser(ctx context.Context, ds model.DataStore, username string) (*model.User, error) {
+	count, err := ds.User(ctx).CountAll()
+	if err != nil {
+		return nil, err
+	}
+
+	id, _ := uuid.NewRandom()
+	randomPassword, err := randomOAuthState()
+	if err != nil {
+		return nil, err
+	}
+	hash, err := hashPassword(randomPassword)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	newUser := model.User{
+		ID:          id.String(),
+		UserName:    username,
+		Name:        strings.Title(username),
+		Email:       username,
+		Password:    hash,
+		IsAdmin:     count == 0,
+		LastLoginAt: &now,
+	}
+	if err := ds.User(ctx).Put(&newUser); err != nil {
+		return nil, err
+	}
+	return &newUser, nil
+}
+
+// directPeerIP returns the IP of whoever is directly connected to us, ignoring
+// any X-Forwarded-For style headers, since those are exactly what an attacker
+// would try to spoof.
+func directPeerIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,60 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/deluan/navidrome/conf"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ipMatchesAny", func() {
+	DescribeTable("matching IPs against a trusted list",
+		func(ip string, list []string, want bool) {
+			Expect(ipMatchesAny(ip, list)).To(Equal(want))
+		},
+		Entry("exact match", "10.0.0.5", []string{"10.0.0.5"}, true),
+		Entry("exact mismatch", "10.0.0.5", []string{"10.0.0.6"}, false),
+		Entry("cidr match", "192.168.1.42", []string{"192.168.1.0/24"}, true),
+		Entry("cidr mismatch", "192.168.2.42", []string{"192.168.1.0/24"}, false),
+		Entry("multiple entries, second matches", "172.16.0.1", []string{"10.0.0.0/8", "172.16.0.0/12"}, true),
+		Entry("empty list", "10.0.0.5", nil, false),
+		Entry("invalid ip", "not-an-ip", []string{"10.0.0.0/8"}, false),
+		Entry("malformed cidr entry is skipped", "10.0.0.5", []string{"not-a-cidr/99", "10.0.0.0/8"}, true),
+	)
+})
+
+var _ = Describe("reverseProxyUser", func() {
+	BeforeEach(func() {
+		conf.Server.ReverseProxyAuth = true
+		conf.Server.ReverseProxyUserHeader = "Remote-User"
+		conf.Server.ReverseProxyAllowedIPs = []string{"127.0.0.1"}
+	})
+
+	AfterEach(func() {
+		conf.Server.ReverseProxyAuth = false
+		conf.Server.ReverseProxyUserHeader = ""
+		conf.Server.ReverseProxyAllowedIPs = nil
+	})
+
+	It("rejects a header asserted from an untrusted source", func() {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Remote-User", "alice")
+		r.RemoteAddr = "203.0.113.9:12345"
+
+		_, attempted, err := reverseProxyUser(r.Context(), nil, r)
+		Expect(attempted).To(BeTrue())
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("is a no-op when the header is absent", func() {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = "127.0.0.1:12345"
+
+		_, attempted, err := reverseProxyUser(r.Context(), nil, r)
+		Expect(attempted).To(BeFalse())
+		Expect(err).ToNot(HaveOccurred())
+	})
+})
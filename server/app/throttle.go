@@ -0,0 +1,231 @@
+package app
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/deluan/navidrome/conf"
+	"github.com/deluan/navidrome/model"
+	"github.com/deluan/rest"
+)
+
+// loginAttempt tracks failed logins for a single username+IP combination.
+type loginAttempt struct {
+	failures    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+// maxLoginAttemptEntries bounds the size of loginAttempts, so that a flood of
+// login attempts against random, nonexistent usernames can't grow the map
+// without limit. Once it's reached, recordFailedLogin sweeps out expired
+// entries to make room before adding a new one.
+const maxLoginAttemptEntries = 10000
+
+var (
+	loginAttemptsMu sync.Mutex
+	loginAttempts   = map[string]*loginAttempt{}
+)
+
+func loginThrottleKey(username, ip string) string {
+	return strings.ToLower(username) + "|" + ip
+}
+
+// checkLoginThrottle returns how long the caller should wait before retrying,
+// and whether they're under a hard lockout. A zero wait means they can proceed
+// immediately.
+func checkLoginThrottle(key string) (wait time.Duration, locked bool) {
+	loginAttemptsMu.Lock()
+	defer loginAttemptsMu.Unlock()
+
+	a, ok := loginAttempts[key]
+	if !ok {
+		return 0, false
+	}
+	now := time.Now()
+	if now.Before(a.lockedUntil) {
+		return a.lockedUntil.Sub(now), true
+	}
+	elapsed := now.Sub(a.lastFailure)
+	if elapsed > conf.Server.Auth.LoginThrottleWindow {
+		delete(loginAttempts, key)
+		return 0, false
+	}
+	if backoff := backoffFor(a.failures); elapsed < backoff {
+		return backoff - elapsed, false
+	}
+	return 0, false
+}
+
+// backoffFor implements the exponential backoff schedule: nothing for the first
+// couple of failures, 1s after 3, 5s after 5. A hard lockout kicks in separately
+// once conf.Server.Auth.MaxFailedLogins is reached.
+func backoffFor(failures int) time.Duration {
+	switch {
+	case failures >= 5:
+		return 5 * time.Second
+	case failures >= 3:
+		return 1 * time.Second
+	default:
+		return 0
+	}
+}
+
+// recordFailedLogin records one more failed attempt for key, escalating to a
+// temporary lockout once conf.Server.Auth.MaxFailedLogins is reached within the
+// configured window.
+func recordFailedLogin(key string) {
+	loginAttemptsMu.Lock()
+	defer loginAttemptsMu.Unlock()
+
+	now := time.Now()
+	a, ok := loginAttempts[key]
+	if !ok || now.Sub(a.lastFailure) > conf.Server.Auth.LoginThrottleWindow {
+		if !ok && len(loginAttempts) >= maxLoginAttemptEntries {
+			evictExpiredLoginAttempts(now)
+		}
+		a = &loginAttempt{}
+		loginAttempts[key] = a
+	}
+	a.failures++
+	a.lastFailure = now
+
+	maxFailures := conf.Server.Auth.MaxFailedLogins
+	if maxFailures > 0 && a.failures >= maxFailures {
+		a.lockedUntil = now.Add(conf.Server.Auth.LockoutDuration)
+	}
+}
+
+// evictExpiredLoginAttempts removes entries whose throttle window has already
+// elapsed and who aren't under an active lockout, to make room in
+// loginAttempts once it hits maxLoginAttemptEntries. Called with
+// loginAttemptsMu held.
+func evictExpiredLoginAttempts(now time.Time) {
+	for key, a := range loginAttempts {
+		if now.Before(a.lockedUntil) {
+			continue
+		}
+		if now.Sub(a.lastFailure) > conf.Server.Auth.LoginThrottleWindow {
+			delete(loginAttempts, key)
+		}
+	}
+}
+
+// clearLoginThrottle resets the failure count for key, called after a successful
+// login.
+func clearLoginThrottle(key string) {
+	loginAttemptsMu.Lock()
+	defer loginAttemptsMu.Unlock()
+	delete(loginAttempts, key)
+}
+
+// clientIP returns the caller's IP, honoring X-Forwarded-For only when the
+// direct peer is in conf.Server.TrustedProxies. This prevents a client from
+// spoofing its IP by just setting the header itself.
+func clientIP(r *http.Request) string {
+	remoteIP, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		remoteIP = r.RemoteAddr
+	}
+	if !ipMatchesAny(remoteIP, conf.Server.TrustedProxies) {
+		return remoteIP
+	}
+	forwarded := r.Header.Get("X-Forwarded-For")
+	if forwarded == "" {
+		return remoteIP
+	}
+	return strings.TrimSpace(strings.Split(forwarded, ",")[0])
+}
+
+// ListLockouts is an admin endpoint that reports every username+IP key with
+// recorded failed logins, and whether each one is currently locked out.
+func ListLockouts(ds model.DataStore) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !requireAdmin(w, r) {
+			return
+		}
+
+		loginAttemptsMu.Lock()
+		defer loginAttemptsMu.Unlock()
+
+		now := time.Now()
+		out := make([]map[string]interface{}, 0, len(loginAttempts))
+		for key, a := range loginAttempts {
+			out = append(out, map[string]interface{}{
+				"key":         key,
+				"failures":    a.failures,
+				"lastFailure": a.lastFailure,
+				"lockedUntil": a.lockedUntil,
+				"locked":      now.Before(a.lockedUntil),
+			})
+		}
+		rest.RespondWithJSON(w, http.StatusOK, out)
+	}
+}
+
+// ClearLockout is an admin endpoint that clears the throttle state for a given
+// username+IP key, as reported by ListLockouts.
+func ClearLockout(ds model.DataStore) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !requireAdmin(w, r) {
+			return
+		}
+
+		var body struct {
+			Key string `json:"key"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Key == "" {
+			rest.RespondWithError(w, http.StatusUnprocessableEntity, "Invalid request payload")
+			return
+		}
+		clearLoginThrottle(body.Key)
+		rest.RespondWithJSON(w, http.StatusOK, map[string]string{"message": "Lockout cleared"})
+	}
+}
+
+func requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	user, ok := r.Context().Value("user").(*model.User)
+	if !ok || user == nil || !user.IsAdmin {
+		rest.RespondWithError(w, http.StatusForbidden, "Admin access required")
+		return false
+	}
+	return true
+}
+
+func retryAfterHeader(w http.ResponseWriter, wait time.Duration) {
+	seconds := int(wait.Seconds())
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+}
+
+// ipMatchesAny reports whether ip is equal to, or falls inside, any of the
+// entries in list. Entries may be plain IPs or CIDR ranges (e.g. "10.0.0.0/8").
+func ipMatchesAny(ip string, list []string) bool {
+	parsedIP := net.ParseIP(ip)
+	if parsedIP == nil {
+		return false
+	}
+	for _, entry := range list {
+		if !strings.Contains(entry, "/") {
+			if entry == ip {
+				return true
+			}
+			continue
+		}
+		_, cidr, err := net.ParseCIDR(entry)
+		if err != nil {
+			continue
+		}
+		if cidr.Contains(parsedIP) {
+			return true
+		}
+	}
+	return false
+}
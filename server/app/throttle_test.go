@@ -0,0 +1,110 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/deluan/navidrome/conf"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("backoffFor", func() {
+	DescribeTable("the escalating backoff schedule",
+		func(failures int, want time.Duration) {
+			Expect(backoffFor(failures)).To(Equal(want))
+		},
+		Entry("no failures", 0, time.Duration(0)),
+		Entry("below the first threshold", 2, time.Duration(0)),
+		Entry("at the first threshold", 3, 1*time.Second),
+		Entry("between thresholds", 4, 1*time.Second),
+		Entry("at the second threshold", 5, 5*time.Second),
+		Entry("beyond the second threshold", 9, 5*time.Second),
+	)
+})
+
+var _ = Describe("login throttling", func() {
+	const key = "throttle-test-user|127.0.0.1"
+
+	BeforeEach(func() {
+		conf.Server.Auth.LoginThrottleWindow = time.Minute
+		conf.Server.Auth.MaxFailedLogins = 6
+		conf.Server.Auth.LockoutDuration = time.Minute
+		delete(loginAttempts, key)
+	})
+
+	AfterEach(func() {
+		delete(loginAttempts, key)
+	})
+
+	It("doesn't throttle a key with no recorded failures", func() {
+		wait, locked := checkLoginThrottle(key)
+		Expect(locked).To(BeFalse())
+		Expect(wait).To(Equal(time.Duration(0)))
+	})
+
+	It("imposes the backoff schedule once the failure thresholds are crossed", func() {
+		for i := 0; i < 3; i++ {
+			recordFailedLogin(key)
+		}
+		wait, locked := checkLoginThrottle(key)
+		Expect(locked).To(BeFalse())
+		Expect(wait).To(BeNumerically(">", 0))
+		Expect(wait).To(BeNumerically("<=", 1*time.Second))
+	})
+
+	It("locks out once MaxFailedLogins is reached", func() {
+		for i := 0; i < conf.Server.Auth.MaxFailedLogins; i++ {
+			recordFailedLogin(key)
+		}
+		wait, locked := checkLoginThrottle(key)
+		Expect(locked).To(BeTrue())
+		Expect(wait).To(BeNumerically(">", 0))
+	})
+
+	It("clears the throttle state on a successful login", func() {
+		recordFailedLogin(key)
+		recordFailedLogin(key)
+		recordFailedLogin(key)
+		clearLoginThrottle(key)
+
+		wait, locked := checkLoginThrottle(key)
+		Expect(locked).To(BeFalse())
+		Expect(wait).To(Equal(time.Duration(0)))
+	})
+})
+
+var _ = Describe("clientIP", func() {
+	BeforeEach(func() {
+		conf.Server.TrustedProxies = []string{"10.0.0.1"}
+	})
+
+	AfterEach(func() {
+		conf.Server.TrustedProxies = nil
+	})
+
+	It("ignores X-Forwarded-For from an untrusted peer", func() {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = "203.0.113.9:12345"
+		r.Header.Set("X-Forwarded-For", "198.51.100.7")
+
+		Expect(clientIP(r)).To(Equal("203.0.113.9"))
+	})
+
+	It("honors X-Forwarded-For from a trusted proxy", func() {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = "10.0.0.1:12345"
+		r.Header.Set("X-Forwarded-For", "198.51.100.7, 10.0.0.1")
+
+		Expect(clientIP(r)).To(Equal("198.51.100.7"))
+	})
+
+	It("falls back to the peer address when there's no X-Forwarded-For", func() {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = "10.0.0.1:12345"
+
+		Expect(clientIP(r)).To(Equal("10.0.0.1"))
+	})
+})
@@ -0,0 +1,235 @@
+package app
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/deluan/navidrome/conf"
+	"github.com/deluan/navidrome/log"
+	"github.com/deluan/navidrome/model"
+	"github.com/deluan/rest"
+	"github.com/go-chi/chi"
+	"github.com/google/uuid"
+)
+
+// accessTokenPrefix is prepended to every personal access token we hand out, so
+// that a leaked token is trivially identifiable as belonging to Navidrome.
+const accessTokenPrefix = "nvd_"
+
+// Access token scopes. A token created with no scopes at all is treated as
+// full access, for compatibility with clients that don't know about scopes
+// yet. A token created with an explicit, non-empty scope list is restricted
+// to exactly what it lists.
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+)
+
+// tokenScopesContextKey is used to stash the scopes of the access token (if
+// any) that authenticated the current request, so downstream handlers can
+// enforce them via requireScope.
+type tokenScopesContextKey struct{}
+
+// requireScope reports whether the request that produced ctx is allowed to
+// perform an action requiring scope. Requests authenticated via JWT (i.e. a
+// normal browser/password login, not a personal access token) always pass,
+// since scopes only constrain what a given access token may do.
+func requireScope(ctx context.Context, scope string) bool {
+	scopes, ok := ctx.Value(tokenScopesContextKey{}).([]string)
+	if !ok || len(scopes) == 0 {
+		return true
+	}
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// TokenList returns the calling user's personal access tokens. The hashed value
+// is never included in the response.
+func TokenList(ds model.DataStore) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := r.Context().Value("user").(*model.User)
+		if !ok || user == nil {
+			rest.RespondWithError(w, http.StatusUnauthorized, "Not authenticated")
+			return
+		}
+
+		tokens, err := ds.AccessToken(r.Context()).FindByUserID(user.ID)
+		if err != nil {
+			log.Error(r, "Listing access tokens", err)
+			rest.RespondWithError(w, http.StatusInternalServerError, "Could not list access tokens")
+			return
+		}
+		rest.RespondWithJSON(w, http.StatusOK, tokens)
+	}
+}
+
+// TokenCreate creates a new personal access token for the calling user. The
+// plaintext token is only ever returned here; only its hash is persisted.
+func TokenCreate(ds model.DataStore) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := r.Context().Value("user").(*model.User)
+		if !ok || user == nil {
+			rest.RespondWithError(w, http.StatusUnauthorized, "Not authenticated")
+			return
+		}
+		if !requireScope(r.Context(), ScopeWrite) {
+			rest.RespondWithError(w, http.StatusForbidden, "Access token scope does not permit managing access tokens")
+			return
+		}
+
+		var body struct {
+			Name      string     `json:"name"`
+			Scopes    []string   `json:"scopes"`
+			ExpiresAt *time.Time `json:"expiresAt"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			log.Error(r, "Parsing request body", err)
+			rest.RespondWithError(w, http.StatusUnprocessableEntity, "Invalid request payload")
+			return
+		}
+		if body.Name == "" {
+			rest.RespondWithError(w, http.StatusUnprocessableEntity, "Name is required")
+			return
+		}
+
+		expiresAt, err := clampAccessTokenExpiry(body.ExpiresAt)
+		if err != nil {
+			rest.RespondWithError(w, http.StatusUnprocessableEntity, err.Error())
+			return
+		}
+
+		plainToken, hashedToken, err := newAccessTokenValue()
+		if err != nil {
+			log.Error(r, "Generating access token", err)
+			rest.RespondWithError(w, http.StatusInternalServerError, "Could not create access token")
+			return
+		}
+
+		id, _ := uuid.NewRandom()
+		token := model.AccessToken{
+			ID:          id.String(),
+			UserID:      user.ID,
+			Name:        body.Name,
+			HashedToken: hashedToken,
+			Scopes:      body.Scopes,
+			CreatedAt:   time.Now(),
+			ExpiresAt:   expiresAt,
+		}
+		if err := ds.AccessToken(r.Context()).Put(&token); err != nil {
+			log.Error(r, "Saving access token", err)
+			rest.RespondWithError(w, http.StatusInternalServerError, "Could not create access token")
+			return
+		}
+
+		rest.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+			"id":        token.ID,
+			"name":      token.Name,
+			"token":     plainToken,
+			"scopes":    token.Scopes,
+			"expiresAt": token.ExpiresAt,
+		})
+	}
+}
+
+// TokenRevoke deletes one of the calling user's personal access tokens. Admins
+// may revoke any user's token.
+func TokenRevoke(ds model.DataStore) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := r.Context().Value("user").(*model.User)
+		if !ok || user == nil {
+			rest.RespondWithError(w, http.StatusUnauthorized, "Not authenticated")
+			return
+		}
+		if !requireScope(r.Context(), ScopeWrite) {
+			rest.RespondWithError(w, http.StatusForbidden, "Access token scope does not permit managing access tokens")
+			return
+		}
+
+		id := chi.URLParam(r, "id")
+		repo := ds.AccessToken(r.Context())
+		token, err := repo.Get(id)
+		if err == model.ErrNotFound || (err == nil && token.UserID != user.ID && !user.IsAdmin) {
+			rest.RespondWithError(w, http.StatusNotFound, "Access token not found")
+			return
+		}
+		if err != nil {
+			log.Error(r, "Loading access token", err)
+			rest.RespondWithError(w, http.StatusInternalServerError, "Could not revoke access token")
+			return
+		}
+
+		if err := repo.Delete(id); err != nil {
+			log.Error(r, "Revoking access token", err)
+			rest.RespondWithError(w, http.StatusInternalServerError, "Could not revoke access token")
+			return
+		}
+		rest.RespondWithJSON(w, http.StatusOK, map[string]string{"message": "Access token revoked"})
+	}
+}
+
+// clampAccessTokenExpiry enforces conf.Server.AccessTokens.MaxExpiry, if the admin
+// has set one, defaulting to it when the caller didn't ask for an expiry at all.
+func clampAccessTokenExpiry(requested *time.Time) (*time.Time, error) {
+	maxExpiry := conf.Server.AccessTokens.MaxExpiry
+	if maxExpiry <= 0 {
+		return requested, nil
+	}
+	latest := time.Now().Add(maxExpiry)
+	if requested == nil || requested.After(latest) {
+		return &latest, nil
+	}
+	return requested, nil
+}
+
+// newAccessTokenValue returns the plaintext token to hand to the caller (once)
+// and the sha256 hash of it that gets persisted.
+func newAccessTokenValue() (plain string, hashed string, err error) {
+	b := make([]byte, 24)
+	if _, err = rand.Read(b); err != nil {
+		return "", "", err
+	}
+	plain = accessTokenPrefix + hex.EncodeToString(b)
+	sum := sha256.Sum256([]byte(plain))
+	hashed = hex.EncodeToString(sum[:])
+	return plain, hashed, nil
+}
+
+// authenticateAccessToken looks up the user associated with a `Bearer nvd_...`
+// token and bumps its LastUsedAt, for use as an alternative to JWT auth in
+// Authenticator. The token's scopes are returned alongside the user so the
+// caller can enforce them via requireScope.
+func authenticateAccessToken(ctx context.Context, ds model.DataStore, tokenValue string) (*model.User, []string, error) {
+	sum := sha256.Sum256([]byte(tokenValue))
+	hashed := hex.EncodeToString(sum[:])
+
+	repo := ds.AccessToken(ctx)
+	token, err := repo.FindByHashedToken(hashed)
+	if err == model.ErrNotFound {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if token.ExpiresAt != nil && token.ExpiresAt.Before(time.Now()) {
+		return nil, nil, nil
+	}
+
+	user, err := ds.User(ctx).Get(token.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := repo.UpdateLastUsedAt(token.ID); err != nil {
+		log.Error("Could not update access token LastUsedAt", "id", token.ID, err)
+	}
+	return user, token.Scopes, nil
+}
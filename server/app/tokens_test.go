@@ -0,0 +1,157 @@
+package app
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/deluan/navidrome/model"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// fakeAccessTokenRepo implements just enough of model.AccessTokenRepository
+// for these tests, by embedding the interface and overriding the methods
+// authenticateAccessToken exercises.
+type fakeAccessTokenRepo struct {
+	model.AccessTokenRepository
+	byHash       map[string]*model.AccessToken
+	lastUsedCall string
+}
+
+func (f *fakeAccessTokenRepo) FindByHashedToken(hashed string) (*model.AccessToken, error) {
+	if t, ok := f.byHash[hashed]; ok {
+		return t, nil
+	}
+	return nil, model.ErrNotFound
+}
+
+func (f *fakeAccessTokenRepo) UpdateLastUsedAt(id string) error {
+	f.lastUsedCall = id
+	return nil
+}
+
+// fakeTokenDataStore implements just enough of model.DataStore to drive
+// authenticateAccessToken: User() and AccessToken().
+type fakeTokenDataStore struct {
+	model.DataStore
+	users  *fakeUserRepo
+	tokens *fakeAccessTokenRepo
+}
+
+func (f *fakeTokenDataStore) User(ctx context.Context) model.UserRepository {
+	return f.users
+}
+
+func (f *fakeTokenDataStore) AccessToken(ctx context.Context) model.AccessTokenRepository {
+	return f.tokens
+}
+
+func (f *fakeUserRepo) Get(id string) (*model.User, error) {
+	for _, u := range f.users {
+		if u.ID == id {
+			return u, nil
+		}
+	}
+	return nil, model.ErrNotFound
+}
+
+func hashOf(plain string) string {
+	sum := sha256.Sum256([]byte(plain))
+	return hex.EncodeToString(sum[:])
+}
+
+var _ = Describe("newAccessTokenValue", func() {
+	It("returns a prefixed plaintext token and its sha256 hash", func() {
+		plain, hashed, err := newAccessTokenValue()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(strings.HasPrefix(plain, accessTokenPrefix)).To(BeTrue())
+		Expect(hashed).To(Equal(hashOf(plain)))
+		Expect(hashed).ToNot(Equal(plain))
+	})
+
+	It("returns a different token on every call", func() {
+		plain1, _, err := newAccessTokenValue()
+		Expect(err).ToNot(HaveOccurred())
+		plain2, _, err := newAccessTokenValue()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(plain1).ToNot(Equal(plain2))
+	})
+})
+
+var _ = Describe("authenticateAccessToken", func() {
+	var ds *fakeTokenDataStore
+	var user *model.User
+
+	BeforeEach(func() {
+		user = &model.User{ID: "u1", UserName: "alice"}
+		ds = &fakeTokenDataStore{
+			users:  newFakeUserRepo(user),
+			tokens: &fakeAccessTokenRepo{byHash: map[string]*model.AccessToken{}},
+		}
+	})
+
+	It("returns the owning user and scopes for a valid token", func() {
+		ds.tokens.byHash[hashOf("nvd_valid")] = &model.AccessToken{
+			ID: "t1", UserID: "u1", Scopes: []string{ScopeRead},
+		}
+
+		got, scopes, err := authenticateAccessToken(context.Background(), ds, "nvd_valid")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(got).To(Equal(user))
+		Expect(scopes).To(Equal([]string{ScopeRead}))
+		Expect(ds.tokens.lastUsedCall).To(Equal("t1"))
+	})
+
+	It("returns no user for an unknown token", func() {
+		got, scopes, err := authenticateAccessToken(context.Background(), ds, "nvd_unknown")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(got).To(BeNil())
+		Expect(scopes).To(BeNil())
+	})
+
+	It("rejects an expired token", func() {
+		expired := time.Now().Add(-time.Hour)
+		ds.tokens.byHash[hashOf("nvd_expired")] = &model.AccessToken{
+			ID: "t2", UserID: "u1", ExpiresAt: &expired,
+		}
+
+		got, _, err := authenticateAccessToken(context.Background(), ds, "nvd_expired")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(got).To(BeNil())
+	})
+
+	It("accepts a token with a future expiry", func() {
+		future := time.Now().Add(time.Hour)
+		ds.tokens.byHash[hashOf("nvd_active")] = &model.AccessToken{
+			ID: "t3", UserID: "u1", ExpiresAt: &future,
+		}
+
+		got, _, err := authenticateAccessToken(context.Background(), ds, "nvd_active")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(got).To(Equal(user))
+	})
+})
+
+var _ = Describe("requireScope", func() {
+	It("allows requests authenticated without a scoped token (e.g. JWT login)", func() {
+		Expect(requireScope(context.Background(), ScopeWrite)).To(BeTrue())
+	})
+
+	It("allows a token with no scopes at all (full access, for backward compatibility)", func() {
+		ctx := context.WithValue(context.Background(), tokenScopesContextKey{}, []string{})
+		Expect(requireScope(ctx, ScopeWrite)).To(BeTrue())
+	})
+
+	It("allows a token whose scopes include the required one", func() {
+		ctx := context.WithValue(context.Background(), tokenScopesContextKey{}, []string{ScopeRead, ScopeWrite})
+		Expect(requireScope(ctx, ScopeWrite)).To(BeTrue())
+	})
+
+	It("denies a token whose scopes don't include the required one", func() {
+		ctx := context.WithValue(context.Background(), tokenScopesContextKey{}, []string{ScopeRead})
+		Expect(requireScope(ctx, ScopeWrite)).To(BeFalse())
+	})
+})